@@ -5,9 +5,13 @@
 package docopt
 
 import (
+	"encoding"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -31,7 +35,7 @@ Merge selects a value from `src` for each field in `dst`, based on the following
 - Otherwise, docopt will ignore the field.
 
 Given a value selected from `src` based on the rules above, Merge will update the field based on the field's type.
-If the type is not supported, Merge will panic, unless it has been bypassed using the `docopt:"-"` tag.
+If the type is not supported, Merge returns an error, unless it has been bypassed using the `docopt:"-"` tag.
 The following field types are currently supported:
 
 - Integers and Floating Point numbers are parsed using `encoding/json` and updated.
@@ -42,7 +46,15 @@ The following field types are currently supported:
 
 - Slices of any of the previous types will be updated with the values found in dst.
 
-- Merger implementations will be permitted to Merge themselves.  (Slices of Mergers are not currently supported.)
+- Merger implementations will be permitted to Merge themselves; a slice of a type implementing
+  Merger gets one element per value, each merged independently.
+
+- Failing the above, a field whose pointer implements `encoding.TextUnmarshaler`, `json.Unmarshaler`,
+  or `flag.Value` is handled through that interface instead: TextUnmarshaler is preferred for a
+  plain string value, json.Unmarshaler for a value that looks numeric, and flag.Value.Set as the
+  last resort. This is how types like `net.IP` can be bound without a bespoke Merger wrapper.
+  Types that implement none of these, such as `time.Duration` and `url.URL`, are not supported
+  here and need a transformer (see WithTransformers) or a Merger.
 
 The following example defines bindings for `-j`, `-w` and `-n` flags, and accepts zero or more URL values:
 
@@ -55,38 +67,186 @@ The following example defines bindings for `-j`, `-w` and `-n` flags, and accept
 	}
 
 If a value in `dst` does not have a field associated with it in `src`, it is silently ignored.
-However, if a field in `dst` does not have a corresponding value in `src`, a panic is produced,
-since the type is no longer consistent with the documented command line interface.
+However, if a field in `dst` does not have a corresponding value in `src`, Merge returns a
+*MergeError wrapping ErrUnknownKey, since the type is no longer consistent with the documented
+command line interface. Merge never panics on data it receives at runtime; an unsupported field
+type or a non-bool value for a bool field also comes back as a *MergeError, wrapping ErrUnsupportedType
+or ErrTypeMismatch respectively, so callers can tell "my struct is out of sync with the usage string"
+apart from "the user passed a bad value" with errors.Is or errors.As. A value that fails to parse for
+its field (such as a non-numeric string for an int field, or an error from a Merger) is returned as
+that parser's own error, prefixed with the tag, and is not a *MergeError.
+
+By default Merge always overwrites fields in `dst`, even if they already hold a non-zero value.  This
+can be changed with MergeOption arguments; see WithOverride, WithoutOverride, WithAppendSlice,
+WithSliceDeepCopy and WithTransformers.
+
+A field that is itself a struct (or a pointer to one, which Merge allocates if nil) is only ever
+descended into when it has no docopt tag and no all-uppercase name of its own, i.e. it would
+otherwise have been ignored entirely; that gives sub-command options a way to be grouped into
+their own struct instead of living in one flat namespace, without hijacking a tagged struct field
+that is meant to be bound as a leaf value (see WithTransformers, or encoding.TextUnmarshaler and
+friends above). See the Naval Fate example for the motivating `Ship`/`Mine` split.
+A field of type `map[string]string` or `map[string]interface{}` is populated with the whole of
+`src` when it has no docopt tag, or with a filtered subset when tagged `docopt:",prefix=foo."`,
+in which case only keys beginning with "foo." are copied in, with that prefix stripped.
+A `map[string]string` field only receives the entries whose value is a string; the others are left out.
+
+A docopt tag may carry extra comma-separated options after the key: `docopt:"-n,default=5"` supplies
+a value to parse in place of a missing or empty one, and `docopt:"URL,required"` turns a missing or
+empty value into a returned error instead of silently leaving the field at its zero value.
+*/
+func Merge(dst interface{}, src map[string]interface{}, opts ...MergeOption) error {
+	mc := newMergeContext(opts)
+	return mc.merge(dst, src)
+}
+
+/*
+MergeOption configures the behavior of Merge, in the spirit of mergo's functional options.  Options
+are applied in the order they are given, so later options win when they conflict.
 */
-func Merge(dst interface{}, src map[string]interface{}) error {
+type MergeOption func(*mergeContext)
+
+// WithOverride causes Merge to overwrite fields in dst even if they already hold a non-zero value.
+// This is the default behavior.
+func WithOverride() MergeOption {
+	return func(mc *mergeContext) { mc.override = true }
+}
+
+// WithoutOverride causes Merge to skip any field in dst that already holds a non-zero value, so
+// docopt results only fill in what a config file or environment did not already provide.
+func WithoutOverride() MergeOption {
+	return func(mc *mergeContext) { mc.override = false }
+}
+
+// WithAppendSlice causes slice fields to have parsed values appended to their existing contents
+// instead of replacing them outright.
+func WithAppendSlice() MergeOption {
+	return func(mc *mergeContext) { mc.appendSlice = true }
+}
+
+// WithSliceDeepCopy causes slice fields to be assigned a copy of the parsed values, rather than
+// sharing the backing array with the value returned by Parse.
+func WithSliceDeepCopy() MergeOption {
+	return func(mc *mergeContext) { mc.sliceDeepCopy = true }
+}
+
+// WithTransformers registers, per field type, a function that takes over merging for any tagged
+// (or all-uppercase) field of that type, in place of Merge's built in type handling.  This is how
+// callers plug in types Merge does not understand natively, such as time.Duration, or a struct
+// type like url.URL: a tagged field is always looked up and dispatched through its transformer (if
+// one is registered) before Merge falls back to its own type handling.  Untagged fields have no key
+// to look up and never reach a transformer; an untagged struct field is still descended into.
+func WithTransformers(fns map[reflect.Type]func(dst, src reflect.Value) error) MergeOption {
+	return func(mc *mergeContext) { mc.transformers = fns }
+}
+
+// mergeContext carries the options for a single Merge call so every field assignment can consult
+// them before writing to dst.
+type mergeContext struct {
+	override      bool
+	appendSlice   bool
+	sliceDeepCopy bool
+	transformers  map[reflect.Type]func(dst, src reflect.Value) error
+}
+
+func newMergeContext(opts []MergeOption) *mergeContext {
+	mc := &mergeContext{override: true}
+	for _, opt := range opts {
+		opt(mc)
+	}
+	return mc
+}
+
+func (mc *mergeContext) merge(dst interface{}, src map[string]interface{}) error {
 	dv := reflect.Indirect(reflect.ValueOf(dst))
 	dt := dv.Type()
 	nf := dt.NumField()
 	for i := 0; i < nf; i++ {
 		ft := dt.Field(i)
-		tag := ft.Tag.Get("docopt")
-		switch {
-		case tag == "-":
+		if ft.PkgPath != "" {
+			continue // unexported; reflect won't let us Addr/Set it, and it has no tag anyway
+		}
+		raw := ft.Tag.Get("docopt")
+		if raw == "-" {
 			continue
-		case tag != "":
-			// okay.
+		}
+		field := dv.Field(i)
+
+		var dtag docoptTag
+		hasTag := false
+		switch {
+		case raw != "":
+			dtag = parseDocoptTag(raw)
+			hasTag = true
 		case strings.ToUpper(ft.Name) == ft.Name:
-			tag = ft.Name
-		default:
+			dtag = docoptTag{key: ft.Name}
+			hasTag = true
+		}
+
+		if !hasTag {
+			// An untagged, non-uppercase field has no key to look up in src. A struct (or
+			// pointer to one) is worth descending into in that case, to support grouping
+			// sub-command options without a flat namespace, and a map is worth populating
+			// with the whole of src; anything else is plain ignored, as it always has been.
+			switch {
+			case isMergeableStruct(field):
+				if err := mc.mergeStructField(field, src); err != nil {
+					return err
+				}
+			case isStringMap(field.Type()):
+				mc.mergeMapField(field, src, "")
+			}
+			continue
+		}
+
+		if isStringMap(field.Type()) {
+			mc.mergeMapField(field, src, dtag.prefix)
 			continue
 		}
+
+		tag := dtag.key
 		val, ok := src[tag]
 		if !ok {
-			panic(fmt.Errorf("value %#v not defined in documentation", tag))
+			return &MergeError{Field: ft.Name, Tag: tag, Err: ErrUnknownKey}
 		}
-		val = val
 
-		fv := dv.Field(i).Addr().Interface()
-		fv = fv
-		// fmt.Printf(".. for field %v (type %T), docopt provides %#v\n", ft.Name, fv, val)
+		if !mc.override && !field.IsZero() {
+			continue
+		}
+
+		if isEmptyDocoptValue(val) {
+			switch {
+			case dtag.hasDefault:
+				val = dtag.def
+			case dtag.required:
+				return &MergeError{Field: ft.Name, Tag: tag, Value: val, Err: ErrRequiredMissing}
+			}
+		}
+
+		if xf, ok := mc.transformers[ft.Type]; ok {
+			if err := xf(field, reflect.ValueOf(val)); err != nil {
+				return fmt.Errorf("%v: %w", tag, err)
+			}
+			continue
+		}
+
+		if handled, err := mc.mergeMergerSlice(field, val); handled {
+			if err != nil {
+				return fmt.Errorf("%v: %w", tag, err)
+			}
+			continue
+		}
+
+		fv := field.Addr().Interface()
 
 		var err error
 		switch fv := fv.(type) {
+		case Merger:
+			err = fv.MergeDocopt(val)
+
+		case encoding.TextUnmarshaler, json.Unmarshaler, flag.Value:
+			err = mergeViaStdlibInterface(fv, val)
+
 		case *string:
 			switch val := val.(type) {
 			case string:
@@ -102,11 +262,15 @@ func Merge(dst interface{}, src map[string]interface{}) error {
 			}
 
 		case *[]string:
+			var parsed []string
 			switch val := val.(type) {
 			case string:
-				*fv = []string{val}
+				parsed = []string{val}
 			case []string:
-				*fv = val
+				parsed = val
+			}
+			if parsed != nil {
+				mc.assignStrings(fv, parsed)
 			}
 
 		case *bool:
@@ -114,7 +278,7 @@ func Merge(dst interface{}, src map[string]interface{}) error {
 			case bool:
 				*fv = val
 			default:
-				panic(fmt.Errorf("expected bool for %v, got %#v", tag, val))
+				err = &MergeError{Field: ft.Name, Tag: tag, Expected: "bool", Value: val, Err: ErrTypeMismatch}
 			}
 
 		case *[]int, *[]int32, *[]int64, *[]float32, *[]float64:
@@ -126,7 +290,7 @@ func Merge(dst interface{}, src map[string]interface{}) error {
 				js = "[" + strings.Join(val, ",") + "]"
 			}
 			if js != "" {
-				err = json.Unmarshal([]byte(js), fv)
+				err = mc.assignNumericSlice(fv, js)
 			}
 
 		case *int, *int32, *int64, *float32, *float64:
@@ -147,22 +311,287 @@ func Merge(dst interface{}, src map[string]interface{}) error {
 				err = json.Unmarshal([]byte(js), fv)
 			}
 
-		case Merger:
-			err = fv.MergeDocopt(val)
-
-			//TODO(scott): support []Merger
-
 		default:
-			panic(fmt.Errorf("field %#v not supported by docopt", ft.Name))
+			err = &MergeError{Field: ft.Name, Tag: tag, Err: ErrUnsupportedType}
 		}
 
 		if err != nil {
-			return fmt.Errorf("%v: %v", tag, err.Error())
+			return fmt.Errorf("%v: %w", tag, err)
 		}
 	}
 	return nil
 }
 
+// assignStrings applies appendSlice and sliceDeepCopy to a []string field.
+func (mc *mergeContext) assignStrings(fv *[]string, parsed []string) {
+	switch {
+	case mc.appendSlice:
+		*fv = append(*fv, parsed...)
+	case mc.sliceDeepCopy:
+		cp := make([]string, len(parsed))
+		copy(cp, parsed)
+		*fv = cp
+	default:
+		*fv = parsed
+	}
+}
+
+// assignNumericSlice applies appendSlice to a numeric slice field parsed from JSON; deep copying
+// is unnecessary here since the values are decoded from JSON text and never share storage with
+// the value returned by Parse.
+func (mc *mergeContext) assignNumericSlice(fv interface{}, js string) error {
+	if !mc.appendSlice {
+		return json.Unmarshal([]byte(js), fv)
+	}
+	rv := reflect.ValueOf(fv).Elem()
+	parsed := reflect.New(rv.Type())
+	if err := json.Unmarshal([]byte(js), parsed.Interface()); err != nil {
+		return err
+	}
+	rv.Set(reflect.AppendSlice(rv, parsed.Elem()))
+	return nil
+}
+
+// docoptTag holds the parsed form of a `docopt:"..."` struct tag.  The first comma-separated
+// part is the lookup key (as before); the remainder are `name=value` or bare options.
+type docoptTag struct {
+	key        string
+	prefix     string
+	def        string
+	hasDefault bool
+	required   bool
+}
+
+func parseDocoptTag(raw string) docoptTag {
+	parts := strings.Split(raw, ",")
+	dt := docoptTag{key: parts[0]}
+	for _, opt := range parts[1:] {
+		switch {
+		case opt == "required":
+			dt.required = true
+		case strings.HasPrefix(opt, "default="):
+			dt.def = strings.TrimPrefix(opt, "default=")
+			dt.hasDefault = true
+		default:
+			if v, ok := strings.CutPrefix(opt, "prefix="); ok {
+				dt.prefix = v
+			}
+		}
+	}
+	return dt
+}
+
+// isEmptyDocoptValue reports whether a value pulled from Parse's results represents "nothing was
+// given", the condition that triggers a default or a required error. A bool is never considered
+// empty, since false is as meaningful an answer as true.
+func isEmptyDocoptValue(val interface{}) bool {
+	switch v := val.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []string:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+// Sentinel errors wrapped by MergeError, for use with errors.Is.
+var (
+	// ErrUnknownKey means a field's docopt tag has no corresponding entry in src, i.e. the
+	// struct has drifted out of sync with the usage string that produced src.
+	ErrUnknownKey = errors.New("docopt: tag not defined in documentation")
+	// ErrUnsupportedType means Merge does not know how to assign to a field of that type.
+	ErrUnsupportedType = errors.New("docopt: field type not supported")
+	// ErrTypeMismatch means the value Parse produced does not match what the field's type expects.
+	ErrTypeMismatch = errors.New("docopt: value type mismatch")
+	// ErrRequiredMissing means a field tagged `required` had no value and no default.
+	ErrRequiredMissing = errors.New("docopt: required value is missing")
+)
+
+/*
+MergeError is returned by Merge in place of the panics it used to raise, so a long-running service
+can recover from a mismatched struct or a bad runtime value without crashing. Use errors.Is to test
+against ErrUnknownKey, ErrUnsupportedType, ErrTypeMismatch or ErrRequiredMissing, or errors.As to
+recover the field, tag, expected kind and observed value that produced it.
+*/
+type MergeError struct {
+	Field    string      // struct field name
+	Tag      string      // docopt tag key used to look the value up in src
+	Expected string      // human-readable description of the expected kind, if relevant
+	Value    interface{} // the value that was observed, if relevant
+	Err      error       // one of ErrUnknownKey, ErrUnsupportedType, ErrTypeMismatch, ErrRequiredMissing
+}
+
+func (e *MergeError) Error() string {
+	if e.Expected == "" {
+		return fmt.Sprintf("%v (field %v)", e.Err, e.Field)
+	}
+	return fmt.Sprintf("%v (field %v): expected %v, got %#v", e.Err, e.Field, e.Expected, e.Value)
+}
+
+func (e *MergeError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	mergerType          = reflect.TypeOf((*Merger)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	flagValueType       = reflect.TypeOf((*flag.Value)(nil)).Elem()
+)
+
+// leafInterface reports whether field's address implements one of the interfaces Merge dispatches
+// leaf values through (Merger, or the standard library's TextUnmarshaler/json.Unmarshaler/flag.Value),
+// in which case struct recursion must not descend into it.
+func leafInterface(field reflect.Value) bool {
+	t := field.Type()
+	if t.Kind() != reflect.Ptr {
+		if !field.CanAddr() {
+			return false
+		}
+		t = reflect.PtrTo(t)
+	}
+	return t.Implements(mergerType) || t.Implements(textUnmarshalerType) ||
+		t.Implements(jsonUnmarshalerType) || t.Implements(flagValueType)
+}
+
+// isMergeableStruct reports whether field should be descended into by merge, rather than treated
+// as a leaf value keyed by its own docopt tag.
+func isMergeableStruct(field reflect.Value) bool {
+	t := field.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	return !leafInterface(field)
+}
+
+// mergeMergerSlice handles a slice field whose element type implements Merger, allocating one
+// element per string value and merging each independently. It reports false when field is not
+// such a slice, leaving the caller to fall through to ordinary leaf handling. appendSlice is
+// honored the same way assignStrings honors it; the slice built here is always freshly
+// allocated, so sliceDeepCopy needs no extra handling, the same as assignNumericSlice.
+func (mc *mergeContext) mergeMergerSlice(field reflect.Value, val interface{}) (bool, error) {
+	t := field.Type()
+	if t.Kind() != reflect.Slice || !reflect.PtrTo(t.Elem()).Implements(mergerType) {
+		return false, nil
+	}
+	var strs []string
+	switch val := val.(type) {
+	case string:
+		strs = []string{val}
+	case []string:
+		strs = val
+	default:
+		return true, fmt.Errorf("expected string(s), got %#v", val)
+	}
+	out := reflect.MakeSlice(t, len(strs), len(strs))
+	for i, s := range strs {
+		ev := reflect.New(t.Elem())
+		if err := ev.Interface().(Merger).MergeDocopt(s); err != nil {
+			return true, err
+		}
+		out.Index(i).Set(ev.Elem())
+	}
+	if mc.appendSlice {
+		out = reflect.AppendSlice(field, out)
+	}
+	field.Set(out)
+	return true, nil
+}
+
+// mergeViaStdlibInterface dispatches a leaf value to whichever standard library interface fv
+// implements, preferring encoding.TextUnmarshaler for a plain string, json.Unmarshaler for a
+// value that looks numeric, and falling back to flag.Value.Set.
+func mergeViaStdlibInterface(fv interface{}, val interface{}) error {
+	str, isStr := val.(string)
+	if tu, ok := fv.(encoding.TextUnmarshaler); ok && isStr {
+		return tu.UnmarshalText([]byte(str))
+	}
+	if ju, ok := fv.(json.Unmarshaler); ok && isStr && looksNumeric(str) {
+		return ju.UnmarshalJSON([]byte(str))
+	}
+	if fv, ok := fv.(flag.Value); ok {
+		switch val := val.(type) {
+		case string:
+			return fv.Set(val)
+		case []string:
+			if len(val) == 1 {
+				return fv.Set(val[0])
+			}
+			return fmt.Errorf("too many values")
+		}
+	}
+	return fmt.Errorf("no compatible interface for %#v", val)
+}
+
+func looksNumeric(s string) bool {
+	_, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return err == nil
+}
+
+// mergeStructField recurses into a struct (allocating through a nil pointer if necessary) using
+// the same src, so its fields resolve their own keys against the flat namespace.
+func (mc *mergeContext) mergeStructField(field reflect.Value, src map[string]interface{}) error {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		return mc.merge(field.Interface(), src)
+	}
+	return mc.merge(field.Addr().Interface(), src)
+}
+
+func isStringMap(t reflect.Type) bool {
+	if t.Kind() != reflect.Map || t.Key().Kind() != reflect.String {
+		return false
+	}
+	switch t.Elem().Kind() {
+	case reflect.String, reflect.Interface:
+		return true
+	default:
+		return false
+	}
+}
+
+// mergeMapField populates a map[string]string or map[string]interface{} field with src, or with
+// the subset of src whose keys start with prefix (the prefix itself is stripped from the key).
+func (mc *mergeContext) mergeMapField(field reflect.Value, src map[string]interface{}, prefix string) {
+	if !mc.override && !field.IsZero() {
+		return
+	}
+	t := field.Type()
+	m := reflect.MakeMapWithSize(t, len(src))
+	for k, v := range src {
+		key := k
+		if prefix != "" {
+			rest, ok := strings.CutPrefix(k, prefix)
+			if !ok {
+				continue
+			}
+			key = rest
+		}
+		if t.Elem().Kind() == reflect.String {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			m.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(s))
+			continue
+		}
+		ev := reflect.ValueOf(v)
+		if !ev.IsValid() {
+			ev = reflect.Zero(t.Elem()) // a nil value; a zero Value would delete the key instead
+		}
+		m.SetMapIndex(reflect.ValueOf(key), ev)
+	}
+	field.Set(m)
+}
+
 /*
 Merger indicates fields that know how to merge a docopt flag or argument value for Merge.
 
@@ -4,11 +4,15 @@
 package docopt
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strconv"
+	"sync"
 	"testing"
 )
 
@@ -50,6 +54,265 @@ func assert(t *testing.T, q bool) {
 	t.Fail()
 }
 
+func TestMergeWithoutOverride(t *testing.T) {
+	o := testOpts{INT: 42}
+	m := map[string]interface{}{
+		"INT": "-3",
+		"OCT": "0755",
+		"-o":  "0755",
+		"-v":  true,
+		"I":   "1",
+		"F":   "2e2",
+		"AI":  []string{"1", "2", "3"},
+	}
+	err := Merge(&o, m, WithoutOverride())
+	if err != nil {
+		t.Errorf("merge-error: %v", err)
+	}
+	assert(t, o.INT == 42) // already set, so not overwritten
+	assert(t, o.I == 1)    // zero value, so filled in
+}
+
+func TestMergeAppendSlice(t *testing.T) {
+	o := testOpts{AI: []int{1}}
+	m := map[string]interface{}{
+		"INT": "-3",
+		"OCT": "0755",
+		"-o":  "0755",
+		"-v":  true,
+		"I":   "1",
+		"F":   "2e2",
+		"AI":  []string{"2", "3"},
+	}
+	err := Merge(&o, m, WithAppendSlice())
+	if err != nil {
+		t.Errorf("merge-error: %v", err)
+	}
+	assert(t, len(o.AI) == 3)
+	assert(t, o.AI[0] == 1)
+	assert(t, o.AI[1] == 2)
+}
+
+func TestMergeNestedStruct(t *testing.T) {
+	var o testNestedOpts
+	m := map[string]interface{}{
+		"-v":     true,
+		"--home": "/tmp",
+	}
+	err := Merge(&o, m)
+	if err != nil {
+		t.Errorf("merge-error: %v", err)
+	}
+	assert(t, o.V)
+	assert(t, o.Sub != nil)
+	assert(t, o.Sub.Home == "/tmp")
+}
+
+func TestMergeSkipsUnexportedField(t *testing.T) {
+	var o testUnexportedOpts
+	m := map[string]interface{}{
+		"-v": true,
+	}
+	err := Merge(&o, m)
+	if err != nil {
+		t.Errorf("merge-error: %v", err)
+	}
+	assert(t, o.V)
+}
+
+type testUnexportedOpts struct {
+	V  bool `docopt:"-v"`
+	mu sync.Mutex
+}
+
+func TestMergeTaggedStructIsLeaf(t *testing.T) {
+	var o testURLOpts
+	m := map[string]interface{}{
+		"--url": "http://example.com",
+	}
+	err := Merge(&o, m)
+	var merr *MergeError
+	if !errors.As(err, &merr) || !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("expected a *MergeError wrapping ErrUnsupportedType, got %v", err)
+	}
+}
+
+func TestMergeTaggedStructViaTransformer(t *testing.T) {
+	var o testURLOpts
+	m := map[string]interface{}{
+		"--url": "http://example.com",
+	}
+	xf := map[reflect.Type]func(dst, src reflect.Value) error{
+		reflect.TypeOf(url.URL{}): func(dst, src reflect.Value) error {
+			u, err := url.Parse(src.Interface().(string))
+			if err != nil {
+				return err
+			}
+			dst.Set(reflect.ValueOf(*u))
+			return nil
+		},
+	}
+	err := Merge(&o, m, WithTransformers(xf))
+	if err != nil {
+		t.Errorf("merge-error: %v", err)
+	}
+	assert(t, o.URL.Host == "example.com")
+}
+
+type testURLOpts struct {
+	URL url.URL `docopt:"--url"`
+}
+
+func TestMergeMapField(t *testing.T) {
+	var o testMapOpts
+	m := map[string]interface{}{
+		"-v":          true,
+		"env.HOME":    "/root",
+		"env.USER":    "root",
+		"--unrelated": "ignored",
+	}
+	err := Merge(&o, m)
+	if err != nil {
+		t.Errorf("merge-error: %v", err)
+	}
+	assert(t, o.V)
+	assert(t, o.Env["HOME"] == "/root")
+	assert(t, o.Env["USER"] == "root")
+	_, ok := o.Env["--unrelated"]
+	assert(t, !ok)
+}
+
+func TestMergeDefault(t *testing.T) {
+	var o testDefaultOpts
+	m := map[string]interface{}{
+		"-n": "",
+	}
+	err := Merge(&o, m)
+	if err != nil {
+		t.Errorf("merge-error: %v", err)
+	}
+	assert(t, o.N == 5)
+}
+
+func TestMergeRequired(t *testing.T) {
+	var o testRequiredOpts
+	m := map[string]interface{}{
+		"URL": "",
+	}
+	err := Merge(&o, m)
+	if !errors.Is(err, ErrRequiredMissing) {
+		t.Errorf("expected ErrRequiredMissing, got %v", err)
+	}
+}
+
+func TestMergeRequiredAlreadySetWithoutOverride(t *testing.T) {
+	o := testRequiredOpts{URL: "https://already-set.example"}
+	m := map[string]interface{}{
+		"URL": "",
+	}
+	err := Merge(&o, m, WithoutOverride())
+	if err != nil {
+		t.Errorf("merge-error: %v", err)
+	}
+	assert(t, o.URL == "https://already-set.example")
+}
+
+func TestMergeUnknownKey(t *testing.T) {
+	var o testRequiredOpts
+	err := Merge(&o, map[string]interface{}{})
+	var merr *MergeError
+	if !errors.As(err, &merr) || !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected a *MergeError wrapping ErrUnknownKey, got %v", err)
+	}
+}
+
+type testDefaultOpts struct {
+	N int `docopt:"-n,default=5"`
+}
+
+type testRequiredOpts struct {
+	URL string `docopt:"URL,required"`
+}
+
+func TestMergeMergerSlice(t *testing.T) {
+	var o testMergerSliceOpts
+	m := map[string]interface{}{
+		"--oct": []string{"0755", "010"},
+	}
+	err := Merge(&o, m)
+	if err != nil {
+		t.Errorf("merge-error: %v", err)
+	}
+	assert(t, len(o.Oct) == 2)
+	assert(t, o.Oct[0] == 0755)
+	assert(t, o.Oct[1] == 010)
+}
+
+func TestMergeMergerSliceAppend(t *testing.T) {
+	o := testMergerSliceOpts{Oct: []testOctal{0755}}
+	m := map[string]interface{}{
+		"--oct": []string{"010"},
+	}
+	err := Merge(&o, m, WithAppendSlice())
+	if err != nil {
+		t.Errorf("merge-error: %v", err)
+	}
+	assert(t, len(o.Oct) == 2)
+	assert(t, o.Oct[0] == 0755)
+	assert(t, o.Oct[1] == 010)
+}
+
+func TestMergeTextUnmarshaler(t *testing.T) {
+	var o testTextOpts
+	m := map[string]interface{}{
+		"--level": "WARN",
+	}
+	err := Merge(&o, m)
+	if err != nil {
+		t.Errorf("merge-error: %v", err)
+	}
+	assert(t, o.Level == testLevelWarn)
+}
+
+type testMergerSliceOpts struct {
+	Oct []testOctal `docopt:"--oct"`
+}
+
+type testLevel int
+
+const (
+	testLevelInfo testLevel = iota
+	testLevelWarn
+)
+
+func (l *testLevel) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "WARN":
+		*l = testLevelWarn
+	default:
+		*l = testLevelInfo
+	}
+	return nil
+}
+
+type testTextOpts struct {
+	Level testLevel `docopt:"--level"`
+}
+
+type testNestedOpts struct {
+	V   bool `docopt:"-v"`
+	Sub *testSubOpts
+}
+
+type testSubOpts struct {
+	Home string `docopt:"--home"`
+}
+
+type testMapOpts struct {
+	V   bool              `docopt:"-v"`
+	Env map[string]string `docopt:",prefix=env."`
+}
+
 type testOpts struct {
 	INT int
 	OCT testOctal